@@ -0,0 +1,699 @@
+// Package local implements a pure-Go watermark encoder/decoder that
+// Client.Encode/Decode can fall back to when Config.Mode is ModeLocal, or
+// when the hosted backend is unreachable and Config.Fallback is set. It
+// embeds the message in the frequency domain of the image's luminance
+// channel using a 2-level Haar DWT, per-block DCT, and SVD singular-value
+// quantization (the DWT-DCT-SVD scheme), so the watermark survives mild
+// JPEG re-encoding without needing a live TruthMark backend.
+package local
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+const (
+	// defaultStrength is the quantization step Delta applied to each
+	// block's largest singular value.
+	defaultStrength = 12.0
+	// defaultRepetitionFactor is how many times each message bit is
+	// repeated across blocks; decode takes the majority vote per group so
+	// a handful of flipped bits doesn't corrupt the message.
+	defaultRepetitionFactor = 5
+	// blockSize is the DCT block width/height within the LL2 sub-band.
+	blockSize = 8
+	// lengthPrefixBits is the size of the length header encoded ahead of
+	// the message payload.
+	lengthPrefixBits = 16
+)
+
+// Metadata holds the result of a local encode, mirroring the shape of the
+// hosted API's metadata so callers get the same fields either way.
+type Metadata struct {
+	PSNR         float64
+	BitsEmbedded int
+}
+
+// Encode embeds message into img and returns the watermarked image plus
+// its Metadata, using the default quantization strength.
+func Encode(img image.Image, message string) (image.Image, Metadata, error) {
+	return EncodeStrength(img, message, defaultStrength)
+}
+
+// EncodeStrength is like Encode but lets the caller override the
+// quantization strength (larger values survive heavier recompression at
+// the cost of visible distortion).
+func EncodeStrength(img image.Image, message string, strength float64) (image.Image, Metadata, error) {
+	if message == "" {
+		return nil, Metadata{}, fmt.Errorf("local: message must not be empty")
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	y, cb, cr := toYCbCr(img)
+	padH, padW := paddedSize(height), paddedSize(width)
+	yPadded := pad(y, height, width, padH, padW)
+
+	level1 := dwt2D(yPadded)
+	level2 := dwt2D(level1.ll)
+
+	bits := frameMessage(message, defaultRepetitionFactor)
+
+	blocksPerRow := len(level2.ll[0]) / blockSize
+	blocksPerCol := len(level2.ll) / blockSize
+	capacity := blocksPerRow * blocksPerCol
+	if len(bits) > capacity {
+		return nil, Metadata{}, fmt.Errorf("local: message needs %d blocks but image only has capacity for %d", len(bits), capacity)
+	}
+
+	for i, bit := range bits {
+		row := (i / blocksPerRow) * blockSize
+		col := (i % blocksPerRow) * blockSize
+		embedBit(level2.ll, row, col, bit, strength)
+	}
+
+	level1.ll = dwt2DInverse(level2)
+	reconstructedY := crop(dwt2DInverse(level1), height, width)
+
+	out := fromYCbCr(reconstructedY, cb, cr, width, height)
+	meta := Metadata{
+		PSNR: psnr(crop(yPadded, height, width), reconstructedY, height, width),
+		// len(bits) includes the length-prefix header; report only the
+		// message payload, matching what the hosted API's field means.
+		BitsEmbedded: len(message) * 8,
+	}
+	return out, meta, nil
+}
+
+// Decode extracts a message previously embedded by Encode, using the
+// default quantization strength.
+func Decode(img image.Image) (found bool, message string, confidence float64, err error) {
+	return DecodeStrength(img, defaultStrength)
+}
+
+// DecodeStrength is like Decode but takes the quantization strength the
+// image was encoded with.
+func DecodeStrength(img image.Image, strength float64) (found bool, message string, confidence float64, err error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	y, _, _ := toYCbCr(img)
+	padH, padW := paddedSize(height), paddedSize(width)
+	yPadded := pad(y, height, width, padH, padW)
+
+	level1 := dwt2D(yPadded)
+	level2 := dwt2D(level1.ll)
+
+	blocksPerRow := len(level2.ll[0]) / blockSize
+	blocksPerCol := len(level2.ll) / blockSize
+	capacity := blocksPerRow * blocksPerCol
+
+	headerBits := lengthPrefixBits * defaultRepetitionFactor
+	if capacity < headerBits {
+		return false, "", 0, nil
+	}
+
+	rawBits := make([]int, capacity)
+	for i := 0; i < capacity; i++ {
+		row := (i / blocksPerRow) * blockSize
+		col := (i % blocksPerRow) * blockSize
+		rawBits[i] = decodeBit(level2.ll, row, col, strength)
+	}
+
+	lengthBits, headerConfidence := majorityVote(rawBits[:headerBits], defaultRepetitionFactor)
+	lengthBytes := bitsToBytes(lengthBits)
+	length := int(lengthBytes[0])<<8 | int(lengthBytes[1])
+
+	messageBitsNeeded := length * 8 * defaultRepetitionFactor
+	totalBitsNeeded := headerBits + messageBitsNeeded
+	if length == 0 || totalBitsNeeded > capacity {
+		return false, "", 0, nil
+	}
+
+	messageBits, messageConfidence := majorityVote(rawBits[headerBits:totalBitsNeeded], defaultRepetitionFactor)
+	return true, string(bitsToBytes(messageBits)), (headerConfidence + messageConfidence) / 2, nil
+}
+
+// --- message framing ---
+
+// frameMessage prefixes message with its length and repeats each bit
+// repetitionFactor times so decode can recover from flipped bits via
+// majority vote.
+func frameMessage(message string, repetitionFactor int) []int {
+	data := []byte(message)
+	buf := make([]byte, 2+len(data))
+	buf[0] = byte(len(data) >> 8)
+	buf[1] = byte(len(data))
+	copy(buf[2:], data)
+
+	bits := bytesToBits(buf)
+	repeated := make([]int, 0, len(bits)*repetitionFactor)
+	for _, b := range bits {
+		for i := 0; i < repetitionFactor; i++ {
+			repeated = append(repeated, b)
+		}
+	}
+	return repeated
+}
+
+func bytesToBits(data []byte) []int {
+	bits := make([]int, 0, len(data)*8)
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, int((b>>uint(i))&1))
+		}
+	}
+	return bits
+}
+
+func bitsToBytes(bits []int) []byte {
+	out := make([]byte, len(bits)/8)
+	for i := range out {
+		var b byte
+		for j := 0; j < 8; j++ {
+			b = b<<1 | byte(bits[i*8+j])
+		}
+		out[i] = b
+	}
+	return out
+}
+
+// majorityVote collapses repetitionFactor-sized groups of bits into a
+// single bit each via majority vote, and reports the fraction of bits
+// within each group that agreed with the winning value.
+func majorityVote(bits []int, repetitionFactor int) ([]int, float64) {
+	n := len(bits) / repetitionFactor
+	result := make([]int, n)
+
+	var agree, total int
+	for i := 0; i < n; i++ {
+		group := bits[i*repetitionFactor : (i+1)*repetitionFactor]
+		var ones int
+		for _, b := range group {
+			ones += b
+		}
+		bit := 0
+		if ones*2 > repetitionFactor {
+			bit = 1
+		}
+		result[i] = bit
+
+		for _, b := range group {
+			total++
+			if b == bit {
+				agree++
+			}
+		}
+	}
+
+	if total == 0 {
+		return result, 0
+	}
+	return result, float64(agree) / float64(total)
+}
+
+// --- bit embedding ---
+
+// embedBit quantizes the DCT block at (row, col)'s largest singular value
+// to the nearest multiple of strength with the given parity (even=0,
+// odd=1), writing the result back into ll in place.
+func embedBit(ll [][]float64, row, col int, bit int, strength float64) {
+	block := extractBlock(ll, row, col, blockSize)
+	coeffs := dct2D(block)
+
+	mid := subMatrix(coeffs, 2, 2, 4)
+	u, sv, vt := svd(mid)
+	sv[0] = quantize(sv[0], strength, bit)
+	setSubMatrix(coeffs, 2, 2, reconstructFromSVD(u, sv, vt))
+
+	setBlock(ll, row, col, idct2D(coeffs))
+}
+
+// decodeBit reads the bit embedded by embedBit at (row, col).
+func decodeBit(ll [][]float64, row, col int, strength float64) int {
+	block := extractBlock(ll, row, col, blockSize)
+	coeffs := dct2D(block)
+	mid := subMatrix(coeffs, 2, 2, 4)
+	_, sv, _ := svd(mid)
+	return parity(int64(math.Round(sv[0] / strength)))
+}
+
+// quantize rounds sigma to the nearest multiple of delta whose integer
+// quotient has the given parity, so decode reads back int(round(sigma /
+// delta)) % 2 == bit.
+func quantize(sigma, delta float64, bit int) float64 {
+	k := int64(math.Round(sigma / delta))
+	if parity(k) != bit {
+		if float64(k)*delta > sigma {
+			k--
+		} else {
+			k++
+		}
+	}
+	return float64(k) * delta
+}
+
+func parity(k int64) int {
+	p := k % 2
+	if p < 0 {
+		p += 2
+	}
+	return int(p)
+}
+
+// --- color conversion ---
+
+func toYCbCr(img image.Image) (y, cb, cr [][]float64) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	y, cb, cr = newMatrix(height, width), newMatrix(height, width), newMatrix(height, width)
+
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			r, g, b, _ := img.At(bounds.Min.X+i, bounds.Min.Y+j).RGBA()
+			yy, cbb, crr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			y[j][i] = float64(yy)
+			cb[j][i] = float64(cbb)
+			cr[j][i] = float64(crr)
+		}
+	}
+	return
+}
+
+func fromYCbCr(y, cb, cr [][]float64, width, height int) image.Image {
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			r, g, b := color.YCbCrToRGB(clamp(y[j][i]), clamp(cb[j][i]), clamp(cr[j][i]))
+			out.Set(i, j, color.RGBA{R: r, G: g, B: b, A: 255})
+		}
+	}
+	return out
+}
+
+func clamp(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(math.Round(v))
+}
+
+func psnr(original, reconstructed [][]float64, height, width int) float64 {
+	var mse float64
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			d := original[j][i] - reconstructed[j][i]
+			mse += d * d
+		}
+	}
+	mse /= float64(height * width)
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// --- padding/cropping ---
+
+// paddedSize rounds n up to a multiple of 32: two Haar levels need the
+// dimension divisible by 4, and the LL2 sub-band is then partitioned into
+// 8x8 DCT blocks, so the padded LL2 side must itself be a multiple of 8.
+func paddedSize(n int) int {
+	const multiple = 32
+	if n%multiple == 0 {
+		return n
+	}
+	return n + (multiple - n%multiple)
+}
+
+// pad grows m to padH x padW by replicating the edge row/column, the way
+// image codecs commonly extend a source that isn't block-aligned.
+func pad(m [][]float64, height, width, padH, padW int) [][]float64 {
+	out := newMatrix(padH, padW)
+	for j := 0; j < padH; j++ {
+		sj := j
+		if sj >= height {
+			sj = height - 1
+		}
+		for i := 0; i < padW; i++ {
+			si := i
+			if si >= width {
+				si = width - 1
+			}
+			out[j][i] = m[sj][si]
+		}
+	}
+	return out
+}
+
+func crop(m [][]float64, height, width int) [][]float64 {
+	out := newMatrix(height, width)
+	for j := 0; j < height; j++ {
+		copy(out[j], m[j][:width])
+	}
+	return out
+}
+
+// --- Haar DWT ---
+
+type subbands struct {
+	ll, lh, hl, hh [][]float64
+}
+
+func dwt2D(m [][]float64) subbands {
+	rowApprox, rowDetail := rowTransform(m)
+	ll, hl := colTransform(rowApprox)
+	lh, hh := colTransform(rowDetail)
+	return subbands{ll: ll, lh: lh, hl: hl, hh: hh}
+}
+
+func dwt2DInverse(s subbands) [][]float64 {
+	rowApprox := colTransformInverse(s.ll, s.hl)
+	rowDetail := colTransformInverse(s.lh, s.hh)
+	return rowTransformInverse(rowApprox, rowDetail)
+}
+
+func rowTransform(m [][]float64) (approx, detail [][]float64) {
+	approx = make([][]float64, len(m))
+	detail = make([][]float64, len(m))
+	for i, row := range m {
+		approx[i], detail[i] = haarForward1D(row)
+	}
+	return
+}
+
+func rowTransformInverse(approx, detail [][]float64) [][]float64 {
+	out := make([][]float64, len(approx))
+	for i := range approx {
+		out[i] = haarInverse1D(approx[i], detail[i])
+	}
+	return out
+}
+
+func colTransform(m [][]float64) (approx, detail [][]float64) {
+	h, w := len(m), len(m[0])
+	halfH := h / 2
+	approx, detail = newMatrix(halfH, w), newMatrix(halfH, w)
+
+	col := make([]float64, h)
+	for j := 0; j < w; j++ {
+		for i := 0; i < h; i++ {
+			col[i] = m[i][j]
+		}
+		a, d := haarForward1D(col)
+		for i := 0; i < halfH; i++ {
+			approx[i][j] = a[i]
+			detail[i][j] = d[i]
+		}
+	}
+	return
+}
+
+func colTransformInverse(approx, detail [][]float64) [][]float64 {
+	halfH, w := len(approx), len(approx[0])
+	out := newMatrix(halfH*2, w)
+
+	a, d := make([]float64, halfH), make([]float64, halfH)
+	for j := 0; j < w; j++ {
+		for i := 0; i < halfH; i++ {
+			a[i] = approx[i][j]
+			d[i] = detail[i][j]
+		}
+		col := haarInverse1D(a, d)
+		for i := range col {
+			out[i][j] = col[i]
+		}
+	}
+	return out
+}
+
+// haarForward1D is the orthonormal single-level Haar transform: each
+// adjacent pair (a, b) produces an approximation coefficient (a+b)/sqrt2
+// and a detail coefficient (a-b)/sqrt2.
+func haarForward1D(data []float64) (approx, detail []float64) {
+	n := len(data) / 2
+	approx, detail = make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		a, b := data[2*i], data[2*i+1]
+		approx[i] = (a + b) / math.Sqrt2
+		detail[i] = (a - b) / math.Sqrt2
+	}
+	return
+}
+
+func haarInverse1D(approx, detail []float64) []float64 {
+	n := len(approx)
+	data := make([]float64, n*2)
+	for i := 0; i < n; i++ {
+		a, d := approx[i], detail[i]
+		data[2*i] = (a + d) / math.Sqrt2
+		data[2*i+1] = (a - d) / math.Sqrt2
+	}
+	return data
+}
+
+// --- block DCT ---
+
+var dctCosTable [blockSize][blockSize]float64
+
+func init() {
+	for x := 0; x < blockSize; x++ {
+		for u := 0; u < blockSize; u++ {
+			dctCosTable[x][u] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * blockSize))
+		}
+	}
+}
+
+func dctCoeff(u int) float64 {
+	if u == 0 {
+		return 1 / math.Sqrt2
+	}
+	return 1
+}
+
+// dct2D is the standard 2D DCT-II used for JPEG-style block transforms.
+func dct2D(block [][]float64) [][]float64 {
+	out := newMatrix(blockSize, blockSize)
+	for u := 0; u < blockSize; u++ {
+		for v := 0; v < blockSize; v++ {
+			var sum float64
+			for x := 0; x < blockSize; x++ {
+				for y := 0; y < blockSize; y++ {
+					sum += block[x][y] * dctCosTable[x][u] * dctCosTable[y][v]
+				}
+			}
+			out[u][v] = 0.25 * dctCoeff(u) * dctCoeff(v) * sum
+		}
+	}
+	return out
+}
+
+// idct2D is the DCT-III inverse of dct2D.
+func idct2D(coeffs [][]float64) [][]float64 {
+	out := newMatrix(blockSize, blockSize)
+	for x := 0; x < blockSize; x++ {
+		for y := 0; y < blockSize; y++ {
+			var sum float64
+			for u := 0; u < blockSize; u++ {
+				for v := 0; v < blockSize; v++ {
+					sum += dctCoeff(u) * dctCoeff(v) * coeffs[u][v] * dctCosTable[x][u] * dctCosTable[y][v]
+				}
+			}
+			out[x][y] = 0.25 * sum
+		}
+	}
+	return out
+}
+
+// --- SVD (Jacobi eigenvalue method on A^T A) ---
+
+// svd decomposes the square matrix a as u * diag(sv) * vt via the
+// Jacobi eigenvalue method on A^T A: its eigenvectors give V, singular
+// values are the square roots of its eigenvalues, and U = A V Sigma^-1.
+func svd(a [][]float64) (u [][]float64, sv []float64, vt [][]float64) {
+	n := len(a)
+	eigenvalues, v := jacobiEigen(matMul(transpose(a), a))
+	order := sortedIndicesDesc(eigenvalues)
+
+	sv = make([]float64, n)
+	vSorted := newMatrix(n, n)
+	for newCol, oldCol := range order {
+		sv[newCol] = math.Sqrt(math.Max(eigenvalues[oldCol], 0))
+		for row := 0; row < n; row++ {
+			vSorted[row][newCol] = v[row][oldCol]
+		}
+	}
+
+	av := matMul(a, vSorted)
+	u = newMatrix(n, n)
+	for col := 0; col < n; col++ {
+		if sv[col] > 1e-9 {
+			for row := 0; row < n; row++ {
+				u[row][col] = av[row][col] / sv[col]
+			}
+		}
+	}
+
+	return u, sv, transpose(vSorted)
+}
+
+// reconstructFromSVD rebuilds u * diag(sv) * vt.
+func reconstructFromSVD(u [][]float64, sv []float64, vt [][]float64) [][]float64 {
+	n := len(sv)
+	sigma := newMatrix(n, n)
+	for i := range sv {
+		sigma[i][i] = sv[i]
+	}
+	return matMul(matMul(u, sigma), vt)
+}
+
+// jacobiEigen computes the eigenvalues and eigenvectors of a symmetric
+// matrix m via the classic cyclic Jacobi rotation method, accurate enough
+// for the small (4x4) matrices used here.
+func jacobiEigen(m [][]float64) (eigenvalues []float64, v [][]float64) {
+	n := len(m)
+	a := newMatrix(n, n)
+	for i := range m {
+		copy(a[i], m[i])
+	}
+	v = identity(n)
+
+	for sweep := 0; sweep < 100; sweep++ {
+		if offDiagonalNorm(a) < 1e-12 {
+			break
+		}
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(a[p][q]) < 1e-15 {
+					continue
+				}
+
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				app, aqq, apq := a[p][p], a[q][q], a[p][q]
+				a[p][p] = c*c*app - 2*s*c*apq + s*s*aqq
+				a[q][q] = s*s*app + 2*s*c*apq + c*c*aqq
+				a[p][q], a[q][p] = 0, 0
+
+				for i := 0; i < n; i++ {
+					if i != p && i != q {
+						aip, aiq := a[i][p], a[i][q]
+						a[i][p] = c*aip - s*aiq
+						a[p][i] = a[i][p]
+						a[i][q] = s*aip + c*aiq
+						a[q][i] = a[i][q]
+					}
+				}
+				for i := 0; i < n; i++ {
+					vip, viq := v[i][p], v[i][q]
+					v[i][p] = c*vip - s*viq
+					v[i][q] = s*vip + c*viq
+				}
+			}
+		}
+	}
+
+	eigenvalues = make([]float64, n)
+	for i := 0; i < n; i++ {
+		eigenvalues[i] = a[i][i]
+	}
+	return
+}
+
+func sortedIndicesDesc(values []float64) []int {
+	idx := make([]int, len(values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return values[idx[i]] > values[idx[j]] })
+	return idx
+}
+
+func offDiagonalNorm(m [][]float64) float64 {
+	var sum float64
+	for i := range m {
+		for j := range m[i] {
+			if i != j {
+				sum += m[i][j] * m[i][j]
+			}
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+// --- generic matrix helpers ---
+
+func newMatrix(rows, cols int) [][]float64 {
+	m := make([][]float64, rows)
+	for i := range m {
+		m[i] = make([]float64, cols)
+	}
+	return m
+}
+
+func identity(n int) [][]float64 {
+	out := newMatrix(n, n)
+	for i := 0; i < n; i++ {
+		out[i][i] = 1
+	}
+	return out
+}
+
+func transpose(m [][]float64) [][]float64 {
+	rows, cols := len(m), len(m[0])
+	out := newMatrix(cols, rows)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			out[j][i] = m[i][j]
+		}
+	}
+	return out
+}
+
+func matMul(a, b [][]float64) [][]float64 {
+	rows, inner, cols := len(a), len(b), len(b[0])
+	out := newMatrix(rows, cols)
+	for i := 0; i < rows; i++ {
+		for k := 0; k < inner; k++ {
+			if a[i][k] == 0 {
+				continue
+			}
+			for j := 0; j < cols; j++ {
+				out[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return out
+}
+
+func extractBlock(m [][]float64, row, col, size int) [][]float64 {
+	out := newMatrix(size, size)
+	for i := 0; i < size; i++ {
+		copy(out[i], m[row+i][col:col+size])
+	}
+	return out
+}
+
+func setBlock(m [][]float64, row, col int, block [][]float64) {
+	for i := range block {
+		copy(m[row+i][col:col+len(block[i])], block[i])
+	}
+}
+
+func subMatrix(m [][]float64, rowOff, colOff, size int) [][]float64 {
+	return extractBlock(m, rowOff, colOff, size)
+}
+
+func setSubMatrix(m [][]float64, rowOff, colOff int, sub [][]float64) {
+	setBlock(m, rowOff, colOff, sub)
+}
@@ -2,21 +2,162 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
 	"io"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/Rount-org/Truthmark-sdk/go/local"
 )
 
+// RoundTripperFunc adapts a function to an http.RoundTripper, the same
+// pattern net/http uses for http.HandlerFunc.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps an http.RoundTripper with additional behavior, such as
+// request signing, tracing, or custom auth, around every call the Client
+// makes.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Mode selects where Client.Encode/Decode execute.
+type Mode int
+
+const (
+	// ModeRemote sends requests to the hosted TruthMark API. This is the
+	// default.
+	ModeRemote Mode = iota
+	// ModeLocal runs encode/decode against the pure-Go truthmark/local
+	// watermarking core instead of calling the hosted API. EncodeURL and
+	// EncodeURLContext still call the hosted API in this mode.
+	ModeLocal
+)
+
+// APIError is returned by Encode/Decode (and their variants) when the
+// server responds with any status other than 200 OK. Callers can
+// errors.As(err, &apiErr) to branch on quota-exceeded vs. invalid-image
+// vs. auth failures instead of matching on an error string.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("truthmark: API error %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("truthmark: API error %d", e.StatusCode)
+}
+
+// errorEnvelope is the standard error body shape the API returns on
+// failure: {"error": {"code": "...", "message": "..."}}.
+type errorEnvelope struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAPIError builds an APIError from a non-2xx response, decoding the
+// standard error envelope when the body matches it and preserving the raw
+// body either way so callers can inspect a non-conforming error response.
+func newAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		Body:       body,
+	}
+
+	var envelope errorEnvelope
+	if json.Unmarshal(body, &envelope) == nil {
+		apiErr.Code = envelope.Error.Code
+		apiErr.Message = envelope.Error.Message
+	}
+
+	return apiErr
+}
+
+// defaultRetryableStatuses are the status codes retried when
+// Config.RetryableStatuses isn't set: rate limiting and upstream/gateway
+// failures that are usually transient.
+var defaultRetryableStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// urlEncodeRequest is the JSON body sent to /v1/encode when the image is
+// referenced by URL rather than uploaded as form data.
+type urlEncodeRequest struct {
+	URL     string `json:"url"`
+	Message string `json:"message"`
+}
+
+// ProgressFunc reports cumulative upload progress for a streamed
+// Encode/Decode call. total is 0 when the size of the source isn't known
+// upfront (e.g. an arbitrary io.Reader).
+type ProgressFunc func(bytesSent, total int64)
+
 // Config holds the client configuration
 type Config struct {
 	BaseURL string
 	APIKey  string
 	Timeout time.Duration
+
+	// ProgressFunc, if set, is called as image bytes are streamed to the
+	// server during Encode/Decode calls.
+	ProgressFunc ProgressFunc
+
+	// MaxRetries is the number of additional attempts made after the
+	// initial request fails with a retryable status or network error.
+	// Defaults to 2.
+	MaxRetries int
+	// RetryBaseDelay is the starting backoff delay, doubling on each
+	// subsequent retry up to RetryMaxDelay. Defaults to 500ms.
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the backoff delay. Defaults to 10s.
+	RetryMaxDelay time.Duration
+	// RetryableStatuses overrides which HTTP status codes are retried.
+	// Defaults to 429, 502, 503, and 504.
+	RetryableStatuses []int
+
+	// Mode selects where Encode/Decode execute. Defaults to ModeRemote.
+	Mode Mode
+	// Fallback, when true, runs Encode/Decode against the local
+	// watermarking core if the hosted API call fails with a transport
+	// error (a non-200 response is returned as an *APIError instead) and
+	// the request body is seekable (so it can be re-read from the start).
+	Fallback bool
+
+	// Transport overrides the http.RoundTripper used for every request,
+	// e.g. to add a proxy, mTLS, or a shared transport with connection
+	// pooling. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	// Middleware wraps Transport with additional behavior. Entries are
+	// applied in order, so the first entry is outermost and sees the
+	// request before and the response after all the others.
+	Middleware []Middleware
 }
 
 // EncodeResult represents the encode API response
@@ -24,6 +165,10 @@ type EncodeResult struct {
 	Status      string `json:"status"`
 	Metadata    Metadata `json:"metadata"`
 	DownloadURL string `json:"download_url"`
+
+	// Image holds the watermarked PNG bytes for a ModeLocal/fallback
+	// encode, where there's no DownloadURL because nothing was uploaded.
+	Image []byte `json:"-"`
 }
 
 // Metadata holds encoding metadata
@@ -41,9 +186,18 @@ type DecodeResult struct {
 
 // Client is the TruthMark API client
 type Client struct {
-	baseURL    string
-	apiKey     string
-	httpClient *http.Client
+	baseURL      string
+	apiKey       string
+	httpClient   *http.Client
+	progressFunc ProgressFunc
+
+	maxRetries        int
+	retryBaseDelay    time.Duration
+	retryMaxDelay     time.Duration
+	retryableStatuses map[int]bool
+
+	mode     Mode
+	fallback bool
 }
 
 // NewClient creates a new TruthMark client
@@ -58,69 +212,371 @@ func NewClient(config *Config) *Client {
 	if config.Timeout == 0 {
 		config.Timeout = 30 * time.Second
 	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 2
+	}
+	if config.RetryBaseDelay == 0 {
+		config.RetryBaseDelay = 500 * time.Millisecond
+	}
+	if config.RetryMaxDelay == 0 {
+		config.RetryMaxDelay = 10 * time.Second
+	}
+	retryableStatuses := config.RetryableStatuses
+	if retryableStatuses == nil {
+		retryableStatuses = defaultRetryableStatuses
+	}
+	statusSet := make(map[int]bool, len(retryableStatuses))
+	for _, s := range retryableStatuses {
+		statusSet[s] = true
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if config.Transport != nil {
+		transport = config.Transport
+	}
+	for i := len(config.Middleware) - 1; i >= 0; i-- {
+		transport = config.Middleware[i](transport)
+	}
 
 	return &Client{
 		baseURL: config.BaseURL,
 		apiKey:  config.APIKey,
 		httpClient: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: transport,
 		},
+		progressFunc:      config.ProgressFunc,
+		maxRetries:        config.MaxRetries,
+		retryBaseDelay:    config.RetryBaseDelay,
+		retryMaxDelay:     config.RetryMaxDelay,
+		retryableStatuses: statusSet,
+		mode:              config.Mode,
+		fallback:          config.Fallback,
+	}
+}
+
+// retryDelay computes the exponential backoff with jitter for the given
+// zero-based retry attempt, honoring retryAfter (parsed from a
+// Retry-After response header) when the server provided one.
+func (c *Client) retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	delay := c.retryBaseDelay << uint(attempt)
+	if delay <= 0 || delay > c.retryMaxDelay {
+		delay = c.retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// retryAfterFromResponse parses the Retry-After header, which the API may
+// send as either a number of seconds or an HTTP date.
+func retryAfterFromResponse(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// doRetrying runs attempt up to c.maxRetries additional times on a
+// retryable status code or network error, backing off exponentially
+// between attempts. r is the request body source: if it implements
+// io.Seeker it's rewound before each retry; if r is nil, attempt rebuilds
+// its own body from scratch every time and is simply called again;
+// otherwise the first failure is returned as-is. attempt's third return value, if
+// non-nil, is a channel that closes once attempt is done reading r (e.g.
+// a streamMultipart upload goroutine); doRetrying waits on it before
+// rewinding r for the next attempt or returning, since the previous
+// attempt's http.Client.Do can return before that goroutine has observed
+// the request finishing and stopped reading.
+func (c *Client) doRetrying(ctx context.Context, r io.Reader, attempt func() (*http.Response, error, <-chan struct{})) (*http.Response, error) {
+	seeker, seekable := r.(io.Seeker)
+	rebuildsOwnBody := r == nil
+
+	var lastErr error
+	for i := 0; ; i++ {
+		if i > 0 {
+			if !rebuildsOwnBody {
+				if !seekable {
+					return nil, fmt.Errorf("truthmark: cannot retry a non-seekable reader: %w", lastErr)
+				}
+				if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+					return nil, fmt.Errorf("truthmark: failed to rewind body for retry: %w", err)
+				}
+			}
+		}
+
+		resp, err, bodyDone := attempt()
+		if err == nil && !c.retryableStatuses[resp.StatusCode] {
+			return resp, nil
+		}
+
+		if err != nil {
+			lastErr = err
+		} else {
+			lastErr = fmt.Errorf("API error: %d", resp.StatusCode)
+		}
+
+		if bodyDone != nil {
+			<-bodyDone
+		}
+
+		if i >= c.maxRetries || (!rebuildsOwnBody && !seekable) {
+			if err == nil {
+				return resp, nil
+			}
+			return nil, lastErr
+		}
+
+		delay := c.retryDelay(i, retryAfterFromResponse(resp))
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
 }
 
-// Encode embeds an invisible watermark into an image
+// progressReader wraps an io.Reader and reports cumulative bytes read
+// through fn as the multipart body is streamed out, the same way Git LFS
+// clients wrap their upload body with a progress counter.
+type progressReader struct {
+	r     io.Reader
+	total int64
+	sent  int64
+	fn    ProgressFunc
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.sent += int64(n)
+		if p.fn != nil {
+			p.fn(p.sent, p.total)
+		}
+	}
+	return n, err
+}
+
+// sizeOf reports the known length of r, or 0 if it can't be determined
+// without consuming it.
+func sizeOf(r io.Reader) int64 {
+	switch v := r.(type) {
+	case *bytes.Reader:
+		return int64(v.Len())
+	case *os.File:
+		if info, err := v.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+// streamMultipart streams a single-file multipart form to endpoint via
+// io.Pipe, so the whole image never has to be buffered in memory, and
+// honors ctx cancellation for uploads of large images. The returned
+// channel closes once the body-writing goroutine has exited (reading r is
+// complete either way), so callers can wait on it before touching r again,
+// e.g. to rewind it for a retry.
+func (c *Client) streamMultipart(ctx context.Context, endpoint, filename string, r io.Reader, fields map[string]string) (*http.Response, error, <-chan struct{}) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	body := io.Reader(r)
+	if c.progressFunc != nil {
+		body = &progressReader{r: r, total: sizeOf(r), fn: c.progressFunc}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		part, err := writer.CreateFormFile("file", filename)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, body); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		for key, value := range fields {
+			if err := writer.WriteField(key, value); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+endpoint, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return nil, err, done
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The writer goroutine may still be parked on a pipe write that
+		// nobody will read anymore; close the read side so it unblocks
+		// instead of leaking, and let the caller wait on done before it
+		// rewinds r.
+		pr.CloseWithError(err)
+		return nil, err, done
+	}
+	return resp, nil, done
+}
+
+// Encode embeds an invisible watermark into an image read from disk.
 func (c *Client) Encode(imagePath, message string) (*EncodeResult, error) {
-	// Open image file
+	return c.EncodeContext(context.Background(), imagePath, message)
+}
+
+// EncodeContext is like Encode but carries ctx, so an upload of a large
+// image can be cancelled or timed out.
+func (c *Client) EncodeContext(ctx context.Context, imagePath, message string) (*EncodeResult, error) {
 	file, err := os.Open(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open image: %w", err)
 	}
 	defer file.Close()
 
-	// Create multipart form
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	return c.encodeStream(ctx, file, filepath.Base(imagePath), message)
+}
+
+// EncodeReader embeds an invisible watermark into an image read from r,
+// for callers that receive images from S3, HTTP, or in-memory decoders
+// and never want to touch the filesystem. filename is used only to set
+// the multipart form file name.
+func (c *Client) EncodeReader(r io.Reader, filename, message string) (*EncodeResult, error) {
+	return c.encodeStream(context.Background(), r, filename, message)
+}
 
-	// Add file
-	part, err := writer.CreateFormFile("file", filepath.Base(imagePath))
+// EncodeBytes embeds an invisible watermark into raw image bytes, e.g. a
+// PNG produced in-memory from an image.RGBA.
+func (c *Client) EncodeBytes(data []byte, filename, message string) (*EncodeResult, error) {
+	return c.encodeStream(context.Background(), bytes.NewReader(data), filename, message)
+}
+
+// encodeStream does the actual streaming multipart POST to /v1/encode
+// shared by Encode, EncodeContext, EncodeReader, and EncodeBytes, retrying
+// on transient failures and dispatching to the local watermarking core
+// per c.mode/c.fallback.
+func (c *Client) encodeStream(ctx context.Context, r io.Reader, filename, message string) (*EncodeResult, error) {
+	if c.mode == ModeLocal {
+		return c.encodeLocal(r, message)
+	}
+
+	resp, err := c.doRetrying(ctx, r, func() (*http.Response, error, <-chan struct{}) {
+		return c.streamMultipart(ctx, "/v1/encode", filename, r, map[string]string{"message": message})
+	})
 	if err != nil {
+		// Only a transport failure (server unreachable) falls back to the
+		// local encoder; a reachable server returning a non-2xx status
+		// (auth, quota, invalid image, ...) is a real error the caller
+		// needs to see, not something to paper over with a local result.
+		if rewound, ok := c.rewindForFallback(r); ok {
+			return c.encodeLocal(rewound, message)
+		}
 		return nil, err
 	}
-	if _, err := io.Copy(part, file); err != nil {
-		return nil, err
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
 	}
 
-	// Add message
-	if err := writer.WriteField("message", message); err != nil {
+	var result EncodeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
+	return &result, nil
+}
 
-	contentType := writer.FormDataContentType()
-	writer.Close()
+// encodeLocal decodes the image read from r and embeds message into it
+// using the truthmark/local watermarking core.
+func (c *Client) encodeLocal(r io.Reader, message string) (*EncodeResult, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("local: failed to decode image: %w", err)
+	}
 
-	// Create request
-	req, err := http.NewRequest("POST", c.baseURL+"/v1/encode", body)
+	watermarked, meta, err := local.Encode(img, message)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", contentType)
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, watermarked); err != nil {
+		return nil, err
 	}
 
-	// Execute request
-	resp, err := c.httpClient.Do(req)
+	return &EncodeResult{
+		Status:   "success",
+		Metadata: Metadata{PSNR: meta.PSNR, BitsEmbedded: meta.BitsEmbedded},
+		Image:    buf.Bytes(),
+	}, nil
+}
+
+// EncodeURL embeds an invisible watermark into an image fetched server-side
+// from url, so the caller never has to download the image themselves.
+func (c *Client) EncodeURL(url, message string) (*EncodeResult, error) {
+	return c.EncodeURLContext(context.Background(), url, message)
+}
+
+// EncodeURLContext is like EncodeURL but carries ctx, so the request can be
+// cancelled or timed out.
+func (c *Client) EncodeURLContext(ctx context.Context, url, message string) (*EncodeResult, error) {
+	payload, err := json.Marshal(urlEncodeRequest{URL: url, Message: message})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRetrying(ctx, nil, func() (*http.Response, error, <-chan struct{}) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/encode", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err, nil
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		return resp, err, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %d", resp.StatusCode)
+		return nil, newAPIError(resp)
 	}
 
-	// Parse response
 	var result EncodeResult
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
@@ -129,57 +585,279 @@ func (c *Client) Encode(imagePath, message string) (*EncodeResult, error) {
 	return &result, nil
 }
 
-// Decode extracts watermark from an image
+// Decode extracts a watermark from an image read from disk.
 func (c *Client) Decode(imagePath string) (*DecodeResult, error) {
-	// Open image file
+	return c.DecodeContext(context.Background(), imagePath)
+}
+
+// DecodeContext is like Decode but carries ctx, so an upload of a large
+// image can be cancelled or timed out.
+func (c *Client) DecodeContext(ctx context.Context, imagePath string) (*DecodeResult, error) {
 	file, err := os.Open(imagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open image: %w", err)
 	}
 	defer file.Close()
 
-	// Create multipart form
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	return c.decodeStream(ctx, file, filepath.Base(imagePath))
+}
 
-	part, err := writer.CreateFormFile("file", filepath.Base(imagePath))
+// DecodeReader extracts a watermark from an image read from r, for callers
+// that receive images from S3, HTTP, or in-memory decoders and never want
+// to touch the filesystem. filename is used only to set the multipart form
+// file name.
+func (c *Client) DecodeReader(r io.Reader, filename string) (*DecodeResult, error) {
+	return c.decodeStream(context.Background(), r, filename)
+}
+
+// DecodeBytes extracts a watermark from raw image bytes, e.g. a PNG
+// produced in-memory from an image.RGBA.
+func (c *Client) DecodeBytes(data []byte, filename string) (*DecodeResult, error) {
+	return c.decodeStream(context.Background(), bytes.NewReader(data), filename)
+}
+
+// decodeStream does the actual streaming multipart POST to /v1/decode
+// shared by Decode, DecodeContext, DecodeReader, and DecodeBytes, retrying
+// on transient failures and dispatching to the local watermarking core
+// per c.mode/c.fallback.
+func (c *Client) decodeStream(ctx context.Context, r io.Reader, filename string) (*DecodeResult, error) {
+	if c.mode == ModeLocal {
+		return c.decodeLocal(r)
+	}
+
+	resp, err := c.doRetrying(ctx, r, func() (*http.Response, error, <-chan struct{}) {
+		return c.streamMultipart(ctx, "/v1/decode", filename, r, nil)
+	})
 	if err != nil {
+		// Only a transport failure (server unreachable) falls back to the
+		// local decoder; a reachable server returning a non-2xx status
+		// (auth, quota, invalid image, ...) is a real error the caller
+		// needs to see, not something to paper over with a local result.
+		if rewound, ok := c.rewindForFallback(r); ok {
+			return c.decodeLocal(rewound)
+		}
 		return nil, err
 	}
-	if _, err := io.Copy(part, file); err != nil {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var result DecodeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
+	return &result, nil
+}
 
-	contentType := writer.FormDataContentType()
-	writer.Close()
+// decodeLocal decodes the image read from r and extracts a message
+// embedded by the truthmark/local watermarking core.
+func (c *Client) decodeLocal(r io.Reader) (*DecodeResult, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("local: failed to decode image: %w", err)
+	}
 
-	// Create request
-	req, err := http.NewRequest("POST", c.baseURL+"/v1/decode", body)
+	found, message, confidence, err := local.Decode(img)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Content-Type", contentType)
-	if c.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	return &DecodeResult{Found: found, Message: message, Confidence: confidence}, nil
+}
+
+// rewindForFallback reports whether r can be re-read from the start for a
+// ModeRemote-failure-to-local fallback: c.fallback must be enabled and r
+// must implement io.Seeker, since the hosted attempt already consumed it.
+func (c *Client) rewindForFallback(r io.Reader) (io.Reader, bool) {
+	if !c.fallback {
+		return nil, false
+	}
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return nil, false
 	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+	return r, true
+}
 
-	// Execute request
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// EncodeInput is a single item submitted to EncodeBatch. Exactly one of
+// Path, Reader, Data, or URL should be set to select which Encode variant
+// handles the item.
+type EncodeInput struct {
+	// Name identifies this input in the corresponding EncodeBatchResult and
+	// is used as the multipart filename for Reader/Data inputs.
+	Name    string
+	Path    string
+	Reader  io.Reader
+	Data    []byte
+	URL     string
+	Message string
+}
+
+// EncodeBatchResult carries the outcome of a single EncodeInput processed
+// by EncodeBatch.
+type EncodeBatchResult struct {
+	Input    EncodeInput
+	Result   *EncodeResult
+	Err      error
+	Duration time.Duration
+}
+
+// DecodeInput is a single item submitted to DecodeBatch. Exactly one of
+// Path, Reader, or Data should be set to select which Decode variant
+// handles the item.
+type DecodeInput struct {
+	// Name identifies this input in the corresponding DecodeBatchResult and
+	// is used as the multipart filename for Reader/Data inputs.
+	Name   string
+	Path   string
+	Reader io.Reader
+	Data   []byte
+}
+
+// DecodeBatchResult carries the outcome of a single DecodeInput processed
+// by DecodeBatch.
+type DecodeBatchResult struct {
+	Input    DecodeInput
+	Result   *DecodeResult
+	Err      error
+	Duration time.Duration
+}
+
+// BatchOptions configures the worker pool used by EncodeBatch/DecodeBatch.
+type BatchOptions struct {
+	// Concurrency caps the number of in-flight requests. Defaults to 4.
+	Concurrency int
+	// Timeout, if set, bounds each individual item via context.WithTimeout.
+	Timeout time.Duration
+}
+
+// EncodeBatch embeds a watermark into each input, running up to
+// opts.Concurrency requests at once. Results are returned in the same
+// order as inputs regardless of completion order.
+func (c *Client) EncodeBatch(inputs []EncodeInput, opts BatchOptions) []EncodeBatchResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %d", resp.StatusCode)
+	results := make([]EncodeBatchResult, len(inputs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, in := range inputs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, in EncodeInput) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx := context.Background()
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			result, err := c.encodeInput(ctx, in)
+			results[i] = EncodeBatchResult{
+				Input:    in,
+				Result:   result,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+		}(i, in)
 	}
 
-	// Parse response
-	var result DecodeResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	wg.Wait()
+	return results
+}
+
+// encodeInput dispatches a single EncodeInput to the Encode variant
+// matching whichever field it set.
+func (c *Client) encodeInput(ctx context.Context, in EncodeInput) (*EncodeResult, error) {
+	switch {
+	case in.Path != "":
+		file, err := os.Open(in.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open image: %w", err)
+		}
+		defer file.Close()
+		return c.encodeStream(ctx, file, filepath.Base(in.Path), in.Message)
+	case in.Reader != nil:
+		return c.encodeStream(ctx, in.Reader, in.Name, in.Message)
+	case in.Data != nil:
+		return c.encodeStream(ctx, bytes.NewReader(in.Data), in.Name, in.Message)
+	case in.URL != "":
+		return c.EncodeURLContext(ctx, in.URL, in.Message)
+	default:
+		return nil, fmt.Errorf("truthmark: EncodeInput must set Path, Reader, Data, or URL")
 	}
+}
 
-	return &result, nil
+// DecodeBatch extracts a watermark from each input, running up to
+// opts.Concurrency requests at once. Results are returned in the same
+// order as inputs regardless of completion order.
+func (c *Client) DecodeBatch(inputs []DecodeInput, opts BatchOptions) []DecodeBatchResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	results := make([]DecodeBatchResult, len(inputs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, in := range inputs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, in DecodeInput) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx := context.Background()
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			result, err := c.decodeInput(ctx, in)
+			results[i] = DecodeBatchResult{
+				Input:    in,
+				Result:   result,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+		}(i, in)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// decodeInput dispatches a single DecodeInput to the Decode variant
+// matching whichever field it set.
+func (c *Client) decodeInput(ctx context.Context, in DecodeInput) (*DecodeResult, error) {
+	switch {
+	case in.Path != "":
+		file, err := os.Open(in.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open image: %w", err)
+		}
+		defer file.Close()
+		return c.decodeStream(ctx, file, filepath.Base(in.Path))
+	case in.Reader != nil:
+		return c.decodeStream(ctx, in.Reader, in.Name)
+	case in.Data != nil:
+		return c.decodeStream(ctx, bytes.NewReader(in.Data), in.Name)
+	default:
+		return nil, fmt.Errorf("truthmark: DecodeInput must set Path, Reader, or Data")
+	}
 }